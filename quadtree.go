@@ -19,8 +19,11 @@
 package quadtree
 
 import (
+	"container/heap"
 	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 // Depth estimate:
@@ -38,9 +41,28 @@ const (
 // Twof is the two dimensional type used as position.
 type Twof [2]float64
 
+// AABB is an axis-aligned bounding box, given by its lower left and upper right corners.
+type AABB struct {
+	Min Twof // Lower left corner
+	Max Twof // Upper right corner
+}
+
+// overlaps reports whether 'a' and 'b' intersect, including when they only touch at an edge.
+func (a AABB) overlaps(b AABB) bool {
+	return a.Min[0] <= b.Max[0] && a.Max[0] >= b.Min[0] &&
+		a.Min[1] <= b.Max[1] && a.Max[1] >= b.Min[1]
+}
+
 // An object that can be stored in a Quadtree must embed this type anonymously.
+//
+// pos is stored behind an atomic.Pointer, not a plain Twof: Quadtree.Move updates it with
+// no lock held (the tree's read paths are lock-free too), so a plain field would race
+// against a concurrent FindNearObjects/ForEachNear/etc. reading the same object's
+// position. halfExtent isn't: nothing mutates it concurrently with a read, since it's
+// meant to be set once via SetHalfExtent before the object is added.
 type Handle struct {
-	pos Twof // This is private to Quadtree
+	pos        atomic.Pointer[Twof] // This is private to Quadtree
+	halfExtent Twof                 // Zero for a point object, otherwise half the width/height of its AABB
 }
 
 // Compute the squared distance between two points
@@ -56,12 +78,54 @@ type Object interface {
 	setPosition(Twof)         // Callback that requests the position to be updated
 }
 
+// AABBer is implemented by objects that occupy an area rather than a single point.
+// Handle implements this unconditionally, so any embedder can opt in by calling
+// SetHalfExtent; objects that never do behave exactly as before (a zero-sized box).
+type AABBer interface {
+	Object
+	GetAABB() AABB
+}
+
 func (p *Handle) getCurrentPosition() Twof {
-	return p.pos
+	if pos := p.pos.Load(); pos != nil {
+		return *pos
+	}
+	return Twof{}
 }
 
 func (p *Handle) setPosition(n Twof) {
-	p.pos = n
+	p.pos.Store(&n)
+}
+
+// GetQuadtreePosition returns the object's current position in the Quadtree.
+func (p *Handle) GetQuadtreePosition() Twof {
+	return p.getCurrentPosition()
+}
+
+// SetHalfExtent gives the object a bounding box of 'he' (half width, half height) centered
+// on its current position, so it can be filed into every child it overlaps instead of
+// just the one its center falls in.
+func (p *Handle) SetHalfExtent(he Twof) {
+	p.halfExtent = he
+}
+
+// GetAABB returns the current axis-aligned bounding box of the object.
+func (p *Handle) GetAABB() AABB {
+	pos := p.getCurrentPosition()
+	return AABB{
+		Min: Twof{pos[0] - p.halfExtent[0], pos[1] - p.halfExtent[1]},
+		Max: Twof{pos[0] + p.halfExtent[0], pos[1] + p.halfExtent[1]},
+	}
+}
+
+// boundingBox returns the AABB occupied by 'o'. Objects that don't implement AABBer are
+// treated as zero-sized points, matching the historical behavior of this package.
+func boundingBox(o Object) AABB {
+	if ab, ok := o.(AABBer); ok {
+		return ab.GetAABB()
+	}
+	pos := o.getCurrentPosition()
+	return AABB{pos, pos}
 }
 
 type quadtree struct {
@@ -76,41 +140,20 @@ type quadtree struct {
 }
 
 // Use MakeQuadtree() to get one.
+//
+// The tree is a copy-on-write structure: every write clones only the nodes on the path it
+// touches and publishes a new root with a single atomic store, while readers load the root
+// once and traverse it without taking any lock at all. Writers still serialize against each
+// other with wmu, but never block a reader and are never blocked by one.
 type Quadtree struct {
-	quadtree
-	mutex sync.RWMutex
-}
-
-// Check if the Quadtree is big enough to contain the given position. This is done by simply making
-// a bigger initial square and moving all objects to the new one. Not a very cheap solution, but
-// it is expected to be done rarely.
-func (t *Quadtree) checkExpand(tf Twof) {
-	changed := false
-	newCorner1 := t.corner1
-	newCorner2 := t.corner2
-	for i := 0; i < 2; i++ {
-		if tf[i] < t.corner1[i] {
-			changed = true
-			newCorner1[i] = t.corner2[i] - (t.corner2[i]-tf[i])*expandFactor
-		}
-		if tf[i] > t.corner2[i] {
-			changed = true
-			newCorner2[i] = t.corner1[i] + (tf[i]-t.corner1[i])*expandFactor
-		}
-	}
-	if !changed {
-		return
-	}
-	t.destroyChildren() // This will move all objects to the root.
-	t.corner1 = newCorner1
-	t.corner2 = newCorner2
-	// Next time an object is added, the tree will expand again.
+	root atomic.Pointer[quadtree]
+	wmu  sync.Mutex
 }
 
 // Empty returns true if this Quadtree is empty. Used for debugging and testing.
 func (t *Quadtree) Empty() bool {
-	// No need to lock for this operation.
-	return t.numObjects == 0 && !t.hasChildren && len(t.objects) == 0
+	root := t.root.Load()
+	return root.numObjects == 0 && !root.hasChildren && len(root.objects) == 0
 }
 
 // Initialize a quadtree
@@ -121,57 +164,123 @@ func (t *quadtree) init(c1, c2 Twof, depth int) {
 	t.depth = depth
 }
 
+// clone returns a shallow copy of t. Every COW mutator below clones before changing
+// anything, so a node already reachable from a published root is never touched again:
+// a reader that loaded that root keeps seeing exactly what it saw at load time.
+func (t *quadtree) clone() *quadtree {
+	c := *t
+	return &c
+}
+
 // MakeQuadtree creates a Quadtree.
 // 'c1' is the corner with the smaller values,
 // 'c2' is the corner with the bigger values.
 func MakeQuadtree(c1, c2 Twof) *Quadtree {
+	root := &quadtree{}
+	root.init(c1, c2, 0)
 	var t Quadtree
-	t.init(c1, c2, 0)
+	t.root.Store(root)
 	return &t
 }
 
-// Local version, making a sub node
-func makequadtree(c1, c2 Twof, depth int) *quadtree {
-	var t quadtree
-	t.init(c1, c2, depth)
-	return &t
+// checkExpand returns a node whose bounds include 'tf', expanding by expandFactor if
+// needed. This is done by simply making a bigger square and moving all objects back to a
+// single leaf; not a very cheap operation, but it is expected to be done rarely. Returns
+// 't' itself, unchanged, if 'tf' is already inside its bounds.
+func (t *quadtree) checkExpand(tf Twof) *quadtree {
+	changed := false
+	newCorner1 := t.corner1
+	newCorner2 := t.corner2
+	for i := 0; i < 2; i++ {
+		if tf[i] < t.corner1[i] {
+			changed = true
+			newCorner1[i] = t.corner2[i] - (t.corner2[i]-tf[i])*expandFactor
+		}
+		if tf[i] > t.corner2[i] {
+			changed = true
+			newCorner2[i] = t.corner1[i] + (tf[i]-t.corner1[i])*expandFactor
+		}
+	}
+	if !changed {
+		return t
+	}
+	clone := t.clone()
+	if clone.hasChildren {
+		clone.destroyChildren() // This will move all objects to the root.
+	}
+	clone.init(newCorner1, newCorner2, clone.depth)
+	// Next time an object is added outside these bounds, the tree will expand again.
+	return clone
+}
+
+// childBounds returns the corners of child (x,y) of this node.
+func (t *quadtree) childBounds(x, y int) (min, max Twof) {
+	if x == 0 {
+		min[0], max[0] = t.corner1[0], t.center[0]
+	} else {
+		min[0], max[0] = t.center[0], t.corner2[0]
+	}
+	if y == 0 {
+		min[1], max[1] = t.corner1[1], t.center[1]
+	} else {
+		min[1], max[1] = t.center[1], t.corner2[1]
+	}
+	return
 }
 
-// Adds or removes an object from the children. The size of objects are considered to be 0,
-// which means an object can only be located in one child.
+// locatePointChild returns the single child that contains 'pos', breaking a tie at a
+// boundary by always preferring the lower-left child, same as this package always has.
+func (t *quadtree) locatePointChild(pos Twof) (int, int) {
+	x := 0
+	if pos[0] > t.center[0] {
+		x = 1
+	}
+	y := 0
+	if pos[1] > t.center[1] {
+		y = 1
+	}
+	return x, y
+}
+
+// Adds or removes an object from the children, replacing each affected child with the
+// result of recursively adding/removing from it. 't' must already be a private clone, not
+// a node reachable from a published root. A sized object is filed into every child its
+// AABB overlaps. A zero-sized (point) object resolves to exactly one child, same as
+// before the AABB overlap test existed: the inclusive overlap test below would otherwise
+// file a point sitting exactly on a split line into two or even four children.
 func (t *quadtree) fileObject(o Object, add bool) {
-	// Figure out in what child the object belongs
-	c := o.getCurrentPosition()
+	box := boundingBox(o)
+	if box.Min == box.Max {
+		x, y := t.locatePointChild(box.Min)
+		if add {
+			t.children[x][y] = t.children[x][y].add(o)
+		} else {
+			t.children[x][y] = t.children[x][y].remove(o)
+		}
+		return
+	}
 	for x := 0; x < 2; x++ {
-		if x == 0 {
-			if c[0] > t.center[0] {
+		for y := 0; y < 2; y++ {
+			min, max := t.childBounds(x, y)
+			if box.Max[0] < min[0] || box.Min[0] > max[0] {
 				continue
 			}
-		} else if c[0] < t.center[0] {
-			continue
-		}
-
-		for y := 0; y < 2; y++ {
-			if y == 0 {
-				if c[1] > t.center[1] {
-					continue
-				}
-			} else if c[1] < t.center[1] {
+			if box.Max[1] < min[1] || box.Min[1] > max[1] {
 				continue
 			}
 
 			// Add or remove the object
 			if add {
-				t.children[x][y].add(o)
+				t.children[x][y] = t.children[x][y].add(o)
 			} else {
-				t.children[x][y].remove(o)
+				t.children[x][y] = t.children[x][y].remove(o)
 			}
-			return
 		}
 	}
 }
 
-// Take a leaf in the quadtree, add children, and move all objects to the children.
+// Take a leaf in the quadtree, add children, and move all objects to the children. 't'
+// must already be a private clone.
 func (t *quadtree) makeChildren() {
 	for x := 0; x < 2; x++ {
 		var minX, maxX float64
@@ -193,7 +302,9 @@ func (t *quadtree) makeChildren() {
 				maxY = t.corner2[1]
 			}
 
-			t.children[x][y] = makequadtree(Twof{minX, minY}, Twof{maxX, maxY}, t.depth+1)
+			child := &quadtree{}
+			child.init(Twof{minX, minY}, Twof{maxX, maxY}, t.depth+1)
+			t.children[x][y] = child
 		}
 	}
 
@@ -205,12 +316,14 @@ func (t *quadtree) makeChildren() {
 	t.hasChildren = true
 }
 
-// Destroys the children of this, and moves all objects in its descendants
-// to the "objects" set
+// Destroys the children of this, and moves all objects in its descendants to the
+// "objects" set. 't' must already be a private clone; its descendants are only read, not
+// mutated, since they may still be shared with a published root.
 func (t *quadtree) destroyChildren() {
 	// Move all objects in descendants of this to the "objects" set
-	t.objects = make([]Object, 0, t.numObjects)
-	t.collectObjects(&t.objects)
+	objects := make([]Object, 0, t.numObjects)
+	t.collectObjects(&objects, make(map[Object]bool, t.numObjects))
+	t.objects = objects
 
 	for x := 0; x < 2; x++ {
 		for y := 0; y < 2; y++ {
@@ -221,70 +334,91 @@ func (t *quadtree) destroyChildren() {
 	t.hasChildren = false
 }
 
-// Removes the specified object
-func (t *quadtree) remove(o Object) {
-	t.numObjects--
-	if t.numObjects < 0 {
-		log.Panicln(">>>>Quadtree:remove numObjects < 0", t)
+// remove returns a new node reflecting removing 'o' from the subtree rooted at 't'. 't'
+// itself, and everything reachable from it, is left untouched.
+func (t *quadtree) remove(o Object) *quadtree {
+	clone := t.clone()
+	clone.numObjects--
+	if clone.numObjects < 0 {
+		log.Panicln(">>>>Quadtree:remove numObjects < 0", clone)
 	}
 
-	if t.hasChildren && t.numObjects < minObjectsPerQuadtree {
-		t.destroyChildren()
+	if clone.hasChildren && clone.numObjects < minObjectsPerQuadtree {
+		clone.destroyChildren()
 	}
 
-	if t.hasChildren {
-		t.fileObject(o, false)
+	if clone.hasChildren {
+		clone.fileObject(o, false)
 	} else {
-		// Find o in the local list
-		for i, o2 := range t.objects {
-			if o2 == o {
-				// Found it
-				if last := len(t.objects) - 1; i == last {
-					t.objects = t.objects[:last]
-				} else {
-					// Move the last element to this position
-					t.objects[i] = t.objects[last]
-					t.objects = t.objects[:last]
-				}
-				return
+		// Find o in the local list, copying the rest into a fresh slice: the old slice may
+		// still be shared with a node a reader is looking at, so it can't be mutated in place.
+		found := false
+		objects := make([]Object, 0, len(clone.objects))
+		for _, o2 := range clone.objects {
+			if !found && o2 == o {
+				found = true
+				continue
 			}
+			objects = append(objects, o2)
+		}
+		if !found {
+			log.Panicln("Quadtree:remove failed to find object")
 		}
-		log.Panicln("Quadtree:remove failed to find object")
+		clone.objects = objects
 	}
+	return clone
 }
 
 // Removes the specified object 'o'.
 func (t *Quadtree) Remove(o Object) {
-	t.mutex.Lock()
-	t.remove(o)
-	t.mutex.Unlock()
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	t.root.Store(t.root.Load().remove(o))
 }
 
 // Add an object 'o' at position 'c'.
 func (t *Quadtree) Add(o Object, c Twof) {
-	t.mutex.Lock()
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
 	o.setPosition(c)
-	t.checkExpand(c)
-	t.add(o)
-	t.mutex.Unlock()
+	box := boundingBox(o)
+	root := t.root.Load()
+	root = root.checkExpand(box.Min)
+	root = root.checkExpand(box.Max)
+	root = root.add(o)
+	t.root.Store(root)
 }
 
-// Add an object
-func (t *quadtree) add(o Object) {
-	t.numObjects++
-	if !t.hasChildren && t.depth < maxQuadtreeDepth && t.numObjects > maxObjectsPerQuadtree {
-		t.makeChildren()
+// add returns a new node reflecting adding 'o' to the subtree rooted at 't'. 't' itself,
+// and everything reachable from it, is left untouched.
+func (t *quadtree) add(o Object) *quadtree {
+	clone := t.clone()
+	clone.numObjects++
+	if !clone.hasChildren && clone.depth < maxQuadtreeDepth && clone.numObjects > maxObjectsPerQuadtree {
+		clone.makeChildren()
 	}
 
-	if t.hasChildren {
-		t.fileObject(o, true) // Use previous pos as the object may be moving asynchronously
+	if clone.hasChildren {
+		clone.fileObject(o, true) // Use previous pos as the object may be moving asynchronously
 	} else {
-		t.objects = append(t.objects, o)
+		// Copy rather than append in place: the old backing array may still be shared with
+		// a node a reader is looking at.
+		objects := make([]Object, len(clone.objects), len(clone.objects)+1)
+		copy(objects, clone.objects)
+		clone.objects = append(objects, o)
 	}
+	return clone
 }
 
 // Test that an object, at the specified position, is already in the quadtree where it should be.
+// Sized objects conservatively always report false, since moving them may change the set
+// of children they overlap even if their center stays in the same one.
 func (t *quadtree) testPresent(o Object, pos Twof) bool {
+	if ab, ok := o.(AABBer); ok {
+		if box := ab.GetAABB(); box.Min != box.Max {
+			return false
+		}
+	}
 	if !t.hasChildren {
 		// There are no children to this tree, which means the object should be in the list of objects.
 		for _, o2 := range t.objects {
@@ -324,48 +458,57 @@ func (t *quadtree) testPresent(o Object, pos Twof) bool {
 
 // Move the position of an object 'o' to position 'to'.
 func (t *Quadtree) Move(o Object, to Twof) {
-	// Assume the obect was moved to another part of the quadtree
-	treeChanged := true
-	// Usually, the object will not be moved from one part of the quadtree to another. Do a test if that is
-	// the case, in which case only a read lock will be needed. This will add a constant cost, but will
-	// allow many more parallel threads.
-	t.mutex.RLock()
-	if t.testPresent(o, to) {
-		treeChanged = false
-		o.setPosition(to)
-	}
-	t.mutex.RUnlock()
-	if treeChanged {
-		t.mutex.Lock()
-		t.remove(o)
+	// Usually, the object will not be moved from one part of the quadtree to another. Do a
+	// lock-free test for that case first, so the common case never takes the write lock or
+	// clones a single node.
+	if t.root.Load().testPresent(o, to) {
 		o.setPosition(to)
-		t.checkExpand(to)
-		t.add(o)
-		t.mutex.Unlock()
+		return
 	}
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	root := t.root.Load().remove(o)
+	o.setPosition(to)
+	box := boundingBox(o)
+	root = root.checkExpand(box.Min)
+	root = root.checkExpand(box.Max)
+	root = root.add(o)
+	t.root.Store(root)
 }
 
-// Adds all objects in this or its descendants to the specified set
-func (t *quadtree) collectObjects(os *[]Object) {
+// Adds all objects in this or its descendants to the specified set. 'seen' filters out
+// objects already added, which happens when a sized object straddles several leaves.
+func (t *quadtree) collectObjects(os *[]Object, seen map[Object]bool) {
 	if t.hasChildren {
 		for x := 0; x < 2; x++ {
 			for y := 0; y < 2; y++ {
-				t.children[x][y].collectObjects(os)
+				t.children[x][y].collectObjects(os, seen)
 			}
 		}
 	} else {
-		*os = append(*os, t.objects...)
+		for _, o := range t.objects {
+			if seen[o] {
+				continue
+			}
+			seen[o] = true
+			*os = append(*os, o)
+		}
 	}
 }
 
-// Find all objects within radius "dist" from "pos".
-func (t *quadtree) findNearObjects(pos Twof, dist float64, objList *[]Object) {
+// Find all objects within radius "dist" from "pos". 'seen' deduplicates objects that are
+// filed under more than one child because they straddle a boundary.
+func (t *quadtree) findNearObjects(pos Twof, dist float64, objList *[]Object, seen map[Object]bool) {
 	dist2 := dist * dist
 	if !t.hasChildren {
 		for _, o := range t.objects {
+			if seen[o] {
+				continue
+			}
 			if computeDist2(pos, o.getCurrentPosition()) > dist2 {
 				continue // This object was too far away
 			}
+			seen[o] = true
 			*objList = append(*objList, o)
 		}
 	} else {
@@ -386,18 +529,446 @@ func (t *quadtree) findNearObjects(pos Twof, dist float64, objList *[]Object) {
 				} else if pos[1]+dist < t.center[1] {
 					continue
 				}
-				t.children[x][y].findNearObjects(pos, dist, objList)
+				t.children[x][y].findNearObjects(pos, dist, objList, seen)
 			}
 		}
 	}
 }
 
+// seenMapPool recycles the map[Object]bool scratch space every traversal uses to dedupe
+// objects straddling more than one leaf. Unlike pooling tree nodes, pooling these is safe
+// under the COW design: a seen map is private,
+// per-call scratch state, never reachable from a published root, so there's no way for a
+// concurrent reader or Snapshot to still be looking at one after it's returned to the pool.
+var seenMapPool = sync.Pool{
+	New: func() interface{} { return make(map[Object]bool) },
+}
+
+// acquireSeenMap returns an empty map[Object]bool from the pool, or a freshly allocated
+// one if the pool is empty.
+func acquireSeenMap() map[Object]bool {
+	return seenMapPool.Get().(map[Object]bool)
+}
+
+// releaseSeenMap clears m and returns it to the pool.
+func releaseSeenMap(m map[Object]bool) {
+	for k := range m {
+		delete(m, k)
+	}
+	seenMapPool.Put(m)
+}
+
 // FindNearObjects finds all objects within radius 'dist' from positin 'pos'.
 func (t *Quadtree) FindNearObjects(pos Twof, dist float64) []Object {
+	return t.FindNearObjectsAppend(nil, pos, dist)
+}
+
+// FindNearObjectsAppend is like FindNearObjects, but appends results to 'dst' instead of
+// allocating a new slice, so a hot loop can reuse the same buffer across calls.
+func (t *Quadtree) FindNearObjectsAppend(dst []Object, pos Twof, dist float64) []Object {
+	seen := acquireSeenMap()
+	defer releaseSeenMap(seen)
+	t.root.Load().findNearObjects(pos, dist, &dst, seen)
+	return dst
+}
+
+// Find all objects whose bounding box overlaps 'box'. 'seen' deduplicates objects that are
+// filed under more than one child because they straddle a boundary.
+func (t *quadtree) findIntersecting(box AABB, objList *[]Object, seen map[Object]bool) {
+	if !t.hasChildren {
+		for _, o := range t.objects {
+			if seen[o] {
+				continue
+			}
+			if !boundingBox(o).overlaps(box) {
+				continue
+			}
+			seen[o] = true
+			*objList = append(*objList, o)
+		}
+		return
+	}
+	for x := 0; x < 2; x++ {
+		for y := 0; y < 2; y++ {
+			min, max := t.childBounds(x, y)
+			if box.Max[0] < min[0] || box.Min[0] > max[0] {
+				continue
+			}
+			if box.Max[1] < min[1] || box.Min[1] > max[1] {
+				continue
+			}
+			t.children[x][y].findIntersecting(box, objList, seen)
+		}
+	}
+}
+
+// FindIntersecting finds all objects whose bounding box overlaps 'box'. Point objects
+// (those that don't implement AABBer, or whose half-extent is zero) match when 'box'
+// contains their position.
+func (t *Quadtree) FindIntersecting(box AABB) []Object {
+	var objList []Object
+	seen := acquireSeenMap()
+	defer releaseSeenMap(seen)
+	t.root.Load().findIntersecting(box, &objList, seen)
+	return objList
+}
+
+// minBoxDist2 returns the squared distance from 'pos' to the closest point of the box
+// [c1, c2], which is 0 when 'pos' is inside the box.
+func minBoxDist2(pos, c1, c2 Twof) float64 {
+	var closest Twof
+	for i := 0; i < 2; i++ {
+		switch {
+		case pos[i] < c1[i]:
+			closest[i] = c1[i]
+		case pos[i] > c2[i]:
+			closest[i] = c2[i]
+		default:
+			closest[i] = pos[i]
+		}
+	}
+	return computeDist2(pos, closest)
+}
+
+// boxHeapItem is a pending node in the best-first box queue, ordered by the minimum
+// possible distance from the query point to anything inside it.
+type boxHeapItem struct {
+	dist2 float64
+	node  *quadtree
+}
+
+// boxHeap is a min-heap of boxHeapItem, so the closest unexplored box is always popped next.
+type boxHeap []boxHeapItem
+
+func (h boxHeap) Len() int            { return len(h) }
+func (h boxHeap) Less(i, j int) bool  { return h[i].dist2 < h[j].dist2 }
+func (h boxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *boxHeap) Push(x interface{}) { *h = append(*h, x.(boxHeapItem)) }
+func (h *boxHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// neighborHeapItem is a candidate k-nearest result.
+type neighborHeapItem struct {
+	dist2 float64
+	obj   Object
+}
+
+// neighborHeap is a max-heap of neighborHeapItem (farthest on top), bounded to size k so
+// the current worst candidate can be evicted in O(log k) once a closer one turns up.
+type neighborHeap []neighborHeapItem
+
+func (h neighborHeap) Len() int            { return len(h) }
+func (h neighborHeap) Less(i, j int) bool  { return h[i].dist2 > h[j].dist2 }
+func (h neighborHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *neighborHeap) Push(x interface{}) { *h = append(*h, x.(neighborHeapItem)) }
+func (h *neighborHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// findKNearest performs a best-first search for the k objects closest to 'pos'. It
+// descends the tree via a min-heap of boxes keyed by their minimum possible distance to
+// 'pos', maintaining a bounded max-heap of the best k candidates seen so far, and prunes
+// any box whose minimum distance already exceeds the current k-th best.
+func (t *quadtree) findKNearest(pos Twof, k int) neighborHeap {
+	if k <= 0 {
+		return nil
+	}
+	boxes := &boxHeap{{dist2: minBoxDist2(pos, t.corner1, t.corner2), node: t}}
+	var best neighborHeap
+	seen := make(map[Object]bool)
+	for boxes.Len() > 0 {
+		top := heap.Pop(boxes).(boxHeapItem)
+		if len(best) >= k && top.dist2 > best[0].dist2 {
+			break // Everything left in the queue is farther than our current k-th best.
+		}
+		node := top.node
+		if !node.hasChildren {
+			for _, o := range node.objects {
+				if seen[o] {
+					continue
+				}
+				seen[o] = true
+				d2 := computeDist2(pos, o.getCurrentPosition())
+				if len(best) < k {
+					heap.Push(&best, neighborHeapItem{d2, o})
+				} else if d2 < best[0].dist2 {
+					heap.Pop(&best)
+					heap.Push(&best, neighborHeapItem{d2, o})
+				}
+			}
+			continue
+		}
+		for x := 0; x < 2; x++ {
+			for y := 0; y < 2; y++ {
+				min, max := node.childBounds(x, y)
+				heap.Push(boxes, boxHeapItem{dist2: minBoxDist2(pos, min, max), node: node.children[x][y]})
+			}
+		}
+	}
+	return best
+}
+
+// FindKNearest returns up to k objects closest to 'pos', nearest first. Fewer than k may
+// be returned if the tree holds fewer objects.
+func (t *Quadtree) FindKNearest(pos Twof, k int) []Object {
+	objs, _ := t.FindKNearestWithDist(pos, k)
+	return objs
+}
+
+// FindKNearestWithDist is like FindKNearest, but also returns each object's squared
+// distance from 'pos', in the same nearest-first order.
+func (t *Quadtree) FindKNearestWithDist(pos Twof, k int) ([]Object, []float64) {
+	best := t.root.Load().findKNearest(pos, k)
+
+	sort.Slice(best, func(i, j int) bool { return best[i].dist2 < best[j].dist2 })
+	objs := make([]Object, len(best))
+	dist2 := make([]float64, len(best))
+	for i, it := range best {
+		objs[i] = it.obj
+		dist2[i] = it.dist2
+	}
+	return objs, dist2
+}
+
+// forEachNear visits every object within radius 'dist' of 'pos', calling fn for each. It
+// returns false as soon as fn does, which aborts the remaining traversal.
+func (t *quadtree) forEachNear(pos Twof, dist float64, fn func(Object) bool, seen map[Object]bool) bool {
+	dist2 := dist * dist
+	if !t.hasChildren {
+		for _, o := range t.objects {
+			if seen[o] {
+				continue
+			}
+			if computeDist2(pos, o.getCurrentPosition()) > dist2 {
+				continue
+			}
+			seen[o] = true
+			if !fn(o) {
+				return false
+			}
+		}
+		return true
+	}
+	for x := 0; x < 2; x++ {
+		if x == 0 {
+			if pos[0]-dist > t.center[0] {
+				continue
+			}
+		} else if pos[0]+dist < t.center[0] {
+			continue
+		}
+		for y := 0; y < 2; y++ {
+			if y == 0 {
+				if pos[1]-dist > t.center[1] {
+					continue
+				}
+			} else if pos[1]+dist < t.center[1] {
+				continue
+			}
+			if !t.children[x][y].forEachNear(pos, dist, fn, seen) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ForEachNear calls fn for every object within radius 'dist' of 'pos', stopping early the
+// moment fn returns false. Useful when the caller only wants the first hit, wants to stop
+// after N results, or wants to stream results into their own structure instead of paying
+// for a materialized slice.
+func (t *Quadtree) ForEachNear(pos Twof, dist float64, fn func(Object) bool) {
+	seen := acquireSeenMap()
+	defer releaseSeenMap(seen)
+	t.root.Load().forEachNear(pos, dist, fn, seen)
+}
+
+// forEachInAABB visits every object whose bounding box overlaps 'box', calling fn for
+// each. It returns false as soon as fn does, which aborts the remaining traversal.
+func (t *quadtree) forEachInAABB(box AABB, fn func(Object) bool, seen map[Object]bool) bool {
+	if !t.hasChildren {
+		for _, o := range t.objects {
+			if seen[o] {
+				continue
+			}
+			if !boundingBox(o).overlaps(box) {
+				continue
+			}
+			seen[o] = true
+			if !fn(o) {
+				return false
+			}
+		}
+		return true
+	}
+	for x := 0; x < 2; x++ {
+		for y := 0; y < 2; y++ {
+			min, max := t.childBounds(x, y)
+			if box.Max[0] < min[0] || box.Min[0] > max[0] {
+				continue
+			}
+			if box.Max[1] < min[1] || box.Min[1] > max[1] {
+				continue
+			}
+			if !t.children[x][y].forEachInAABB(box, fn, seen) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ForEachInAABB calls fn for every object whose bounding box overlaps the box [min, max],
+// stopping early the moment fn returns false.
+func (t *Quadtree) ForEachInAABB(min, max Twof, fn func(Object) bool) {
+	seen := acquireSeenMap()
+	defer releaseSeenMap(seen)
+	t.root.Load().forEachInAABB(AABB{Min: min, Max: max}, fn, seen)
+}
+
+// slabIntersect clips the ray parameter range [tMin, tMax] to the portion during which
+// origin+t*dir lies inside the box [c1, c2], using the standard slab test. It returns
+// ok=false if the ray misses the box entirely within that range.
+func slabIntersect(origin, dir, c1, c2 Twof, tMin, tMax float64) (float64, float64, bool) {
+	for i := 0; i < 2; i++ {
+		if dir[i] == 0 {
+			if origin[i] < c1[i] || origin[i] > c2[i] {
+				return 0, 0, false
+			}
+			continue
+		}
+		invD := 1 / dir[i]
+		t1 := (c1[i] - origin[i]) * invD
+		t2 := (c2[i] - origin[i]) * invD
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		if t1 > tMin {
+			tMin = t1
+		}
+		if t2 < tMax {
+			tMax = t2
+		}
+		if tMin > tMax {
+			return 0, 0, false
+		}
+	}
+	return tMin, tMax, true
+}
+
+// rayHeapItem is a pending node in the best-first ray queue, ordered by the ray parameter
+// at which it is first entered.
+type rayHeapItem struct {
+	tEnter float64
+	node   *quadtree
+}
+
+// rayHeap is a min-heap of rayHeapItem, so the box the ray reaches soonest is popped next.
+type rayHeap []rayHeapItem
+
+func (h rayHeap) Len() int            { return len(h) }
+func (h rayHeap) Less(i, j int) bool  { return h[i].tEnter < h[j].tEnter }
+func (h rayHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *rayHeap) Push(x interface{}) { *h = append(*h, x.(rayHeapItem)) }
+func (h *rayHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// raycastFirst walks children in ray-parameter order, using the slab test's entry
+// distance to decide which unexplored box to look at next, so the first real hit
+// short-circuits the rest of the traversal.
+func (t *quadtree) raycastFirst(origin, dir Twof, maxDist float64) (Object, float64, bool) {
+	rootEnter, _, ok := slabIntersect(origin, dir, t.corner1, t.corner2, 0, maxDist)
+	if !ok {
+		return nil, 0, false
+	}
+	queue := &rayHeap{{tEnter: rootEnter, node: t}}
+	var bestObj Object
+	bestT := maxDist
+	for queue.Len() > 0 {
+		top := heap.Pop(queue).(rayHeapItem)
+		if bestObj != nil && top.tEnter > bestT {
+			break // Everything left in the queue enters later than our current best hit.
+		}
+		node := top.node
+		if !node.hasChildren {
+			for _, o := range node.objects {
+				box := boundingBox(o)
+				enter, _, ok := slabIntersect(origin, dir, box.Min, box.Max, 0, bestT)
+				if !ok {
+					continue
+				}
+				if bestObj == nil || enter < bestT {
+					bestObj = o
+					bestT = enter
+				}
+			}
+			continue
+		}
+		for x := 0; x < 2; x++ {
+			for y := 0; y < 2; y++ {
+				min, max := node.childBounds(x, y)
+				enter, _, ok := slabIntersect(origin, dir, min, max, 0, bestT)
+				if !ok {
+					continue
+				}
+				heap.Push(queue, rayHeapItem{tEnter: enter, node: node.children[x][y]})
+			}
+		}
+	}
+	if bestObj == nil {
+		return nil, 0, false
+	}
+	return bestObj, bestT, true
+}
+
+// RaycastFirst returns the first object hit by the ray from 'origin' along direction
+// 'dir' (expected to be a unit vector) out to 'maxDist', or ok=false if nothing is hit.
+// It walks children in the order the ray reaches them, so a hit in a near box prunes
+// farther boxes without visiting them.
+func (t *Quadtree) RaycastFirst(origin, dir Twof, maxDist float64) (Object, float64, bool) {
+	return t.root.Load().raycastFirst(origin, dir, maxDist)
+}
+
+// QuadtreeSnapshot is an immutable point-in-time view of a Quadtree, safe to query from
+// any number of goroutines without taking a lock. Get one with Quadtree.Snapshot.
+//
+// Thanks to the tree's copy-on-write structure, a snapshot is just the root pointer
+// captured at this instant: published nodes are never mutated, only replaced by new ones
+// further up the tree, so the nodes reachable from this root stay exactly as they were
+// regardless of writes made to the Quadtree afterwards. Capturing one only loads the root
+// pointer, so it's fine to take one before every individual query rather than only once
+// per batch of queries. Object positions are not part of the snapshot: they are stored in
+// each object's Handle, so a query on the snapshot tests every object's current position,
+// including any Move made after the snapshot was taken.
+type QuadtreeSnapshot struct {
+	root *quadtree
+}
+
+// Snapshot captures an immutable view of the Quadtree's current contents.
+func (t *Quadtree) Snapshot() *QuadtreeSnapshot {
+	return &QuadtreeSnapshot{root: t.root.Load()}
+}
+
+// FindNearObjects finds all objects within radius 'dist' from position 'pos'.
+func (s *QuadtreeSnapshot) FindNearObjects(pos Twof, dist float64) []Object {
 	var objList []Object
-	t.mutex.RLock()
-	t.findNearObjects(pos, dist, &objList)
-	t.mutex.RUnlock()
+	seen := acquireSeenMap()
+	defer releaseSeenMap(seen)
+	s.root.findNearObjects(pos, dist, &objList, seen)
 	return objList
 }
 
@@ -0,0 +1,94 @@
+// Copyright 2012-1013 Lars Pensjo
+//
+// Ephenation is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Ephenation is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// See <http://www.gnu.org/licenses/>.
+//
+
+package quadtree
+
+// Item is the handle returned by GenericQuadtree[T].Add. Pass it back to Move or Remove
+// to update or delete the stored value later.
+type Item[T any] struct {
+	Handle
+	value T
+}
+
+// Value returns the value stored in this item.
+func (it *Item[T]) Value() T {
+	return it.value
+}
+
+// PositionFunc extracts the position of a value of type T. It is configured with
+// MakeGenericQuadtreeWithPositionFunc for callers whose position already lives on T
+// itself. AddAt calls it once, when the value is added; from then on the quadtree keeps
+// the position in the value's Item, and later changes go through Move.
+type PositionFunc[T any] func(T) Twof
+
+// GenericQuadtree is a type-safe counterpart to the package's Quadtree. It stores values
+// of type T directly: callers get back T from FindNearObjects without a type assertion,
+// and don't need to embed Handle in T themselves. Use MakeGenericQuadtree to get one.
+type GenericQuadtree[T any] struct {
+	inner   *Quadtree
+	posFunc PositionFunc[T]
+}
+
+// MakeGenericQuadtree creates a GenericQuadtree[T]. 'c1' is the corner with the smaller
+// values, 'c2' is the corner with the bigger values.
+func MakeGenericQuadtree[T any](c1, c2 Twof) *GenericQuadtree[T] {
+	return &GenericQuadtree[T]{inner: MakeQuadtree(c1, c2)}
+}
+
+// MakeGenericQuadtreeWithPositionFunc is like MakeGenericQuadtree, but also configures
+// 'posFunc' so that AddAt can derive a value's position from the value itself.
+func MakeGenericQuadtreeWithPositionFunc[T any](c1, c2 Twof, posFunc PositionFunc[T]) *GenericQuadtree[T] {
+	return &GenericQuadtree[T]{inner: MakeQuadtree(c1, c2), posFunc: posFunc}
+}
+
+// Add stores 'v' at position 'pos' and returns a handle to use with Move and Remove.
+func (q *GenericQuadtree[T]) Add(v T, pos Twof) *Item[T] {
+	it := &Item[T]{value: v}
+	q.inner.Add(it, pos)
+	return it
+}
+
+// AddAt stores 'v' at the position reported by the Quadtree's PositionFunc. It panics if
+// the Quadtree wasn't constructed with MakeGenericQuadtreeWithPositionFunc.
+func (q *GenericQuadtree[T]) AddAt(v T) *Item[T] {
+	if q.posFunc == nil {
+		panic("quadtree: AddAt requires a GenericQuadtree constructed with MakeGenericQuadtreeWithPositionFunc")
+	}
+	return q.Add(v, q.posFunc(v))
+}
+
+// Move moves 'it' to position 'to'.
+func (q *GenericQuadtree[T]) Move(it *Item[T], to Twof) {
+	q.inner.Move(it, to)
+}
+
+// Remove removes 'it' from the Quadtree.
+func (q *GenericQuadtree[T]) Remove(it *Item[T]) {
+	q.inner.Remove(it)
+}
+
+// FindNearObjects finds all values within radius 'dist' from position 'pos'.
+func (q *GenericQuadtree[T]) FindNearObjects(pos Twof, dist float64) []T {
+	objs := q.inner.FindNearObjects(pos, dist)
+	result := make([]T, len(objs))
+	for i, o := range objs {
+		result[i] = o.(*Item[T]).value
+	}
+	return result
+}
+
+// Empty returns true if this Quadtree is empty. Used for debugging and testing.
+func (q *GenericQuadtree[T]) Empty() bool {
+	return q.inner.Empty()
+}
@@ -19,18 +19,21 @@ func basicTree() *Quadtree {
 
 func TestInitial(t *testing.T) {
 	tree := basicTree()
-	if !tree.Empty() || tree.hasChildren || tree.quadtree.numObjects > 0 || len(tree.objects) != 0 {
+	root := tree.root.Load()
+	if !tree.Empty() || root.hasChildren || root.numObjects > 0 || len(root.objects) != 0 {
 		t.Error("Initial tree not empty")
 	}
 
 	var x1 o
 	tree.Add(&x1, Twof{1.0, 2.0})
-	if tree.numObjects != 1 || tree.Empty() {
+	root = tree.root.Load()
+	if root.numObjects != 1 || tree.Empty() {
 		t.Error("Expected size 1")
 	}
 
 	tree.Remove(&x1)
-	if !tree.Empty() || tree.hasChildren || tree.numObjects > 0 || len(tree.objects) != 0 {
+	root = tree.root.Load()
+	if !tree.Empty() || root.hasChildren || root.numObjects > 0 || len(root.objects) != 0 {
 		t.Error("Tree should be empty")
 	}
 }
@@ -99,6 +102,308 @@ func BenchmarkFind(t *testing.B) {
 	// t.Log(t.N, "objects: found", float64(tot)/float64(t.N), "on average")
 }
 
+// Measure allocations when repeatedly moving objects. Nodes are not pooled: a pooled node
+// could be handed to a writer while a concurrent reader (or Snapshot) still held a pointer
+// to it, which is a use-after-free hazard now that Quadtree is copy-on-write (see its doc
+// comment). A move that crosses a leaf boundary allocates the clones along its path, so
+// this only reports allocs/op rather than asserting zero; most moves stay within the same
+// leaf and take Move's lock-free fast path, whose only allocation is the stored copy of
+// the new position.
+func BenchmarkMoveAlloc(t *testing.B) {
+	t.StopTimer()
+	tree := basicTree()
+	list := make([]o, t.N)
+	positions := make([]Twof, t.N)
+	for i := range list {
+		positions[i][0] = rand.Float64()
+		positions[i][1] = rand.Float64()
+	}
+	for i := range list {
+		tree.Add(&list[i], positions[i])
+	}
+	delta := 1 / math.Sqrt(float64(t.N)) // Distance to move
+	newPositions := make([]Twof, t.N)
+	for i := range newPositions {
+		newPositions[i] = Twof{
+			positions[i][0] + (rand.Float64()-0.5)*delta,
+			positions[i][1] + (rand.Float64()-0.5)*delta,
+		}
+	}
+	for i := range list {
+		tree.Move(&list[i], newPositions[i])
+	}
+	t.ReportAllocs()
+	t.StartTimer()
+	for i := range list {
+		tree.Move(&list[i], positions[i])
+	}
+}
+
+func TestForEachNearStopsEarly(t *testing.T) {
+	tree := basicTree()
+	var list [10]o
+	for i := range list {
+		tree.Add(&list[i], Twof{float64(i) / 10.0, 0})
+	}
+	visited := 0
+	tree.ForEachNear(Twof{0, 0}, 1, func(Object) bool {
+		visited++
+		return visited < 3
+	})
+	if visited != 3 {
+		t.Errorf("expected traversal to stop after 3 visits, got %v", visited)
+	}
+}
+
+func TestForEachInAABBStopsEarlyAndMatchesSizedObjects(t *testing.T) {
+	tree := basicTree()
+	var a, b, c o
+	tree.Add(&a, Twof{0.1, 0.1})
+	tree.Add(&b, Twof{0.2, 0.2})
+	c.SetHalfExtent(Twof{0.05, 0.05})
+	tree.Add(&c, Twof{0.5, 0.5})
+
+	var got []Object
+	tree.ForEachInAABB(Twof{0, 0}, Twof{0.3, 0.3}, func(obj Object) bool {
+		got = append(got, obj)
+		return true
+	})
+	if len(got) != 2 {
+		t.Errorf("expected 2 objects in [0,0]-[0.3,0.3], got %v", got)
+	}
+
+	// This box overlaps c's extent [0.45,0.55] but not its center.
+	got = nil
+	tree.ForEachInAABB(Twof{0.54, 0.54}, Twof{0.6, 0.6}, func(obj Object) bool {
+		got = append(got, obj)
+		return true
+	})
+	if len(got) != 1 || got[0] != Object(&c) {
+		t.Errorf("expected only the sized object in [0.54,0.54]-[0.6,0.6], got %v", got)
+	}
+
+	visited := 0
+	tree.ForEachInAABB(Twof{0, 0}, Twof{1, 1}, func(Object) bool {
+		visited++
+		return visited < 2
+	})
+	if visited != 2 {
+		t.Errorf("expected traversal to stop after 2 visits, got %v", visited)
+	}
+}
+
+func TestRaycastFirst(t *testing.T) {
+	tree := basicTree()
+	var near, far o
+	tree.Add(&near, Twof{0.3, 0.5})
+	tree.Add(&far, Twof{0.7, 0.5})
+
+	obj, dist, ok := tree.RaycastFirst(Twof{0, 0.5}, Twof{1, 0}, 1)
+	if !ok {
+		t.Fatal("expected the ray to hit an object")
+	}
+	if obj != Object(&near) {
+		t.Errorf("expected the nearer object to be hit first, got %v", obj)
+	}
+	if math.Abs(dist-0.3) > 1e-9 {
+		t.Errorf("expected hit distance 0.3, got %v", dist)
+	}
+
+	if _, _, ok := tree.RaycastFirst(Twof{0, 0.9}, Twof{1, 0}, 1); ok {
+		t.Error("expected a ray that misses every object to report no hit")
+	}
+
+	if _, _, ok := tree.RaycastFirst(Twof{0, 0.5}, Twof{1, 0}, 0.1); ok {
+		t.Error("expected a ray shorter than the distance to the nearest object to report no hit")
+	}
+}
+
+func TestSnapshotIsUnaffectedByLaterWrites(t *testing.T) {
+	tree := basicTree()
+	var x1 o
+	tree.Add(&x1, Twof{0.5, 0.5})
+
+	snap := tree.Snapshot()
+	if got := len(snap.FindNearObjects(Twof{0.5, 0.5}, 0.1)); got != 1 {
+		t.Errorf("expected 1 object in snapshot, got %v", got)
+	}
+
+	var x2 o
+	tree.Add(&x2, Twof{0.5, 0.5})
+	tree.Remove(&x1)
+
+	if got := len(snap.FindNearObjects(Twof{0.5, 0.5}, 0.1)); got != 1 {
+		t.Errorf("expected snapshot to still report 1 object after later writes, got %v", got)
+	}
+	if got := len(tree.FindNearObjects(Twof{0.5, 0.5}, 0.1)); got != 1 {
+		t.Errorf("expected live tree to report 1 object, got %v", got)
+	}
+}
+
+func TestHandleGetAABB(t *testing.T) {
+	var h o
+	h.setPosition(Twof{1, 1})
+	h.SetHalfExtent(Twof{0.5, 0.25})
+	got := h.GetAABB()
+	want := AABB{Min: Twof{0.5, 0.75}, Max: Twof{1.5, 1.25}}
+	if got != want {
+		t.Errorf("GetAABB() = %+v, want %+v", got, want)
+	}
+}
+
+// spreadPoints returns 11 positions spread across all four quadrants of basicTree,
+// enough to force a split (maxObjectsPerQuadtree is 10) without any single quadrant
+// individually exceeding it.
+func spreadPoints() []Twof {
+	return []Twof{
+		{0.1, 0.1}, {0.2, 0.1}, {0.1, 0.2},
+		{0.9, 0.1}, {0.8, 0.1}, {0.9, 0.2},
+		{0.1, 0.9}, {0.2, 0.9}, {0.1, 0.8},
+		{0.9, 0.9}, {0.8, 0.9},
+	}
+}
+
+// countInChildren returns how many of the tree's direct children have obj in their leaf
+// object list.
+func countInChildren(tree *Quadtree, obj Object) int {
+	root := tree.root.Load()
+	count := 0
+	for x := 0; x < 2; x++ {
+		for y := 0; y < 2; y++ {
+			for _, o := range root.children[x][y].objects {
+				if o == obj {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+func TestPointOnSplitLineFilesIntoOneChild(t *testing.T) {
+	tree := basicTree()
+	points := spreadPoints()
+	list := make([]o, len(points)+1)
+	for i, pos := range points {
+		tree.Add(&list[i], pos)
+	}
+	root := tree.root.Load()
+	if !root.hasChildren {
+		t.Fatal("expected tree to have split after 11 adds")
+	}
+
+	// This point sits exactly on both split lines.
+	center := &list[len(points)]
+	tree.Add(center, Twof{0.5, 0.5})
+
+	if got := countInChildren(tree, center); got != 1 {
+		t.Errorf("expected point on split line to be filed into exactly one child, got %v", got)
+	}
+
+	root = tree.root.Load()
+	total := 0
+	for x := 0; x < 2; x++ {
+		for y := 0; y < 2; y++ {
+			total += root.children[x][y].numObjects
+		}
+	}
+	if total != len(list) {
+		t.Errorf("expected children's numObjects to sum to %v distinct adds, got %v", len(list), total)
+	}
+}
+
+func TestSizedObjectFiledInEveryOverlappingChild(t *testing.T) {
+	tree := basicTree()
+	points := spreadPoints()
+	list := make([]o, len(points))
+	for i, pos := range points {
+		tree.Add(&list[i], pos)
+	}
+	if !tree.root.Load().hasChildren {
+		t.Fatal("expected tree to have split after 11 adds")
+	}
+
+	var big o
+	big.SetHalfExtent(Twof{0.3, 0.3})
+	tree.Add(&big, Twof{0.5, 0.5}) // Box [0.2,0.2]-[0.8,0.8] straddles all 4 children.
+
+	if got := countInChildren(tree, &big); got != 4 {
+		t.Errorf("expected object straddling the center to be filed into all 4 children, got %v", got)
+	}
+
+	found := tree.FindNearObjects(Twof{0.5, 0.5}, 0.01)
+	count := 0
+	for _, obj := range found {
+		if obj == Object(&big) {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected dedup to report the straddling object exactly once, got %v", count)
+	}
+}
+
+func TestFindIntersecting(t *testing.T) {
+	tree := basicTree()
+	var a, b, c o
+	tree.Add(&a, Twof{0.2, 0.2})
+	tree.Add(&b, Twof{0.8, 0.8})
+	c.SetHalfExtent(Twof{0.05, 0.05})
+	tree.Add(&c, Twof{0.5, 0.5})
+
+	got := tree.FindIntersecting(AABB{Min: Twof{0.1, 0.1}, Max: Twof{0.3, 0.3}})
+	if len(got) != 1 || got[0] != Object(&a) {
+		t.Errorf("expected FindIntersecting to find only 'a', got %v", got)
+	}
+
+	got = tree.FindIntersecting(AABB{Min: Twof{0.45, 0.45}, Max: Twof{0.55, 0.55}})
+	if len(got) != 1 || got[0] != Object(&c) {
+		t.Errorf("expected FindIntersecting to find only 'c', got %v", got)
+	}
+}
+
+func TestFindKNearest(t *testing.T) {
+	tree := basicTree()
+	positions := []Twof{{0.1, 0.1}, {0.2, 0.2}, {0.9, 0.9}, {0.5, 0.5}, {0.15, 0.1}}
+	list := make([]o, len(positions))
+	for i, pos := range positions {
+		tree.Add(&list[i], pos)
+	}
+
+	got := tree.FindKNearest(Twof{0, 0}, 3)
+	want := []Object{&list[0], &list[4], &list[1]}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v results, got %v", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("result[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFindKNearestWithDistReturnsSortedSquaredDistances(t *testing.T) {
+	tree := basicTree()
+	var a, b, c o
+	tree.Add(&a, Twof{0.1, 0})
+	tree.Add(&b, Twof{0.2, 0})
+	tree.Add(&c, Twof{0.3, 0})
+
+	// Ask for more neighbors than exist: should return all 3, not panic or pad.
+	objs, dist2 := tree.FindKNearestWithDist(Twof{0, 0}, 5)
+	if len(objs) != 3 || len(dist2) != 3 {
+		t.Fatalf("expected all 3 objects when k > count, got %v", len(objs))
+	}
+	for i := 1; i < len(dist2); i++ {
+		if dist2[i] < dist2[i-1] {
+			t.Errorf("expected distances sorted ascending, got %v", dist2)
+		}
+	}
+	if math.Abs(dist2[0]-0.01) > 1e-9 {
+		t.Errorf("expected nearest squared distance 0.01, got %v", dist2[0])
+	}
+}
+
 type ball struct {
 	Handle
 	// Add other attributes here
@@ -117,3 +422,64 @@ func ExampleBalls() {
 	fmt.Println("Found", len(list))
 	// Output: Found 3
 }
+
+func ExampleGenericQuadtree() {
+	upperLeft := Twof{0, 0}
+	lowerRight := Twof{1, 1}
+	tree := MakeGenericQuadtree[string](upperLeft, lowerRight)
+	// Create 10 named balls and add them to the quadtree
+	for i := 0; i < 10; i++ {
+		tree.Add(fmt.Sprintf("ball%d", i), Twof{float64(i) / 10.0, 0})
+	}
+	list := tree.FindNearObjects(Twof{0.5, 0.1}, 0.2)
+	fmt.Println("Found", len(list))
+	// Output: Found 3
+}
+
+func TestGenericQuadtreeMoveAndRemove(t *testing.T) {
+	tree := MakeGenericQuadtree[string](Twof{0, 0}, Twof{1, 1})
+	it := tree.Add("a", Twof{0.1, 0.1})
+	tree.Add("b", Twof{0.9, 0.9})
+
+	if got := tree.FindNearObjects(Twof{0.1, 0.1}, 0.05); len(got) != 1 || got[0] != "a" {
+		t.Errorf("expected to find 'a' near its position, got %v", got)
+	}
+
+	tree.Move(it, Twof{0.9, 0.9})
+	if got := tree.FindNearObjects(Twof{0.1, 0.1}, 0.05); len(got) != 0 {
+		t.Errorf("expected nothing left near the old position after Move, got %v", got)
+	}
+	if got := tree.FindNearObjects(Twof{0.9, 0.9}, 0.05); len(got) != 2 {
+		t.Errorf("expected 2 objects near the new position after Move, got %v", got)
+	}
+
+	tree.Remove(it)
+	if got := tree.FindNearObjects(Twof{0.9, 0.9}, 0.05); len(got) != 1 || got[0] != "b" {
+		t.Errorf("expected only 'b' left after Remove, got %v", got)
+	}
+}
+
+type namedThing struct {
+	name string
+	pos  Twof
+}
+
+func TestGenericQuadtreeAddAtUsesPositionFunc(t *testing.T) {
+	tree := MakeGenericQuadtreeWithPositionFunc[namedThing](Twof{0, 0}, Twof{1, 1}, func(v namedThing) Twof { return v.pos })
+	tree.AddAt(namedThing{name: "a", pos: Twof{0.3, 0.3}})
+
+	got := tree.FindNearObjects(Twof{0.3, 0.3}, 0.05)
+	if len(got) != 1 || got[0].name != "a" {
+		t.Errorf("expected AddAt to file the value at the position its PositionFunc reports, got %v", got)
+	}
+}
+
+func TestGenericQuadtreeAddAtPanicsWithoutPositionFunc(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected AddAt to panic when the tree has no PositionFunc")
+		}
+	}()
+	tree := MakeGenericQuadtree[string](Twof{0, 0}, Twof{1, 1})
+	tree.AddAt("x")
+}